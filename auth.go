@@ -0,0 +1,275 @@
+package httpmirror
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Auth authenticates incoming requests before they reach the mirror.
+type Auth interface {
+	// Validate checks the credentials carried by r and, if they are
+	// valid, returns the authenticated user name. proxy selects which
+	// header carries the credentials: Proxy-Authorization for forward
+	// proxy/CONNECT traffic, Authorization otherwise.
+	Validate(r *http.Request, proxy bool) (user string, ok bool)
+	// Challenge writes the response headers that ask the client to
+	// (re)send credentials, using the proxy or origin-server challenge
+	// header depending on proxy.
+	Challenge(w http.ResponseWriter, proxy bool)
+}
+
+// basicAuthHeader returns the request header that carries HTTP Basic
+// credentials for the given traffic type: forward proxy and CONNECT
+// clients (curl -x, apt, Docker) authenticate against the proxy hop with
+// Proxy-Authorization, never Authorization.
+func basicAuthHeader(proxy bool) string {
+	if proxy {
+		return "Proxy-Authorization"
+	}
+	return "Authorization"
+}
+
+// challengeHeader returns the response header used to ask for HTTP Basic
+// credentials for the given traffic type.
+func challengeHeader(proxy bool) string {
+	if proxy {
+		return "Proxy-Authenticate"
+	}
+	return "WWW-Authenticate"
+}
+
+// basicAuthCredentials extracts HTTP Basic credentials from the header
+// selected by proxy.
+func basicAuthCredentials(r *http.Request, proxy bool) (user, pass string, ok bool) {
+	auth := r.Header.Get(basicAuthHeader(proxy))
+	const prefix = "Basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	idx := strings.IndexByte(string(decoded), ':')
+	if idx < 0 {
+		return "", "", false
+	}
+	return string(decoded[:idx]), string(decoded[idx+1:]), true
+}
+
+// StaticAuth is an Auth backed by a single fixed user/pass pair.
+type StaticAuth struct {
+	Username string
+	Password string
+}
+
+func (a *StaticAuth) Validate(r *http.Request, proxy bool) (string, bool) {
+	user, pass, ok := basicAuthCredentials(r, proxy)
+	if !ok {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(user), []byte(a.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(pass), []byte(a.Password)) != 1 {
+		return "", false
+	}
+	return user, true
+}
+
+func (a *StaticAuth) Challenge(w http.ResponseWriter, proxy bool) {
+	w.Header().Set(challengeHeader(proxy), `Basic realm="httpmirror"`)
+}
+
+// FileAuth is an Auth backed by an Apache-style htpasswd file. Entries may
+// use bcrypt, MD5 (apr1) or SHA hashes. The file is re-read whenever its
+// modification time changes.
+type FileAuth struct {
+	// Path is the path to the htpasswd file.
+	Path string
+
+	mut     sync.RWMutex
+	modTime time.Time
+	users   map[string]string
+}
+
+func (a *FileAuth) Validate(r *http.Request, proxy bool) (string, bool) {
+	user, pass, ok := basicAuthCredentials(r, proxy)
+	if !ok {
+		return "", false
+	}
+
+	users, err := a.load()
+	if err != nil {
+		return "", false
+	}
+
+	hash, ok := users[user]
+	if !ok || !verifyHtpasswd(hash, pass) {
+		return "", false
+	}
+	return user, true
+}
+
+func (a *FileAuth) Challenge(w http.ResponseWriter, proxy bool) {
+	w.Header().Set(challengeHeader(proxy), `Basic realm="httpmirror"`)
+}
+
+// load returns the parsed htpasswd file, reloading it from disk if its
+// mtime has changed since the last read.
+func (a *FileAuth) load() (map[string]string, error) {
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mut.RLock()
+	if a.users != nil && info.ModTime().Equal(a.modTime) {
+		users := a.users
+		a.mut.RUnlock()
+		return users, nil
+	}
+	a.mut.RUnlock()
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.users != nil && info.ModTime().Equal(a.modTime) {
+		return a.users, nil
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		users[line[:idx]] = line[idx+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	a.users = users
+	a.modTime = info.ModTime()
+	return users, nil
+}
+
+// verifyHtpasswd checks pass against a single htpasswd hash, supporting
+// the bcrypt, MD5 (apr1) and SHA schemes produced by `htpasswd`. crypt(3)
+// DES hashes are not supported and always fail.
+func verifyHtpasswd(hash, pass string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(md5Crypt(pass, hash))) == 1
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	default:
+		return false
+	}
+}
+
+const md5CryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt recomputes an apr1/MD5-crypt hash of pass using the magic and
+// salt taken from existing, an "$apr1$salt$digest" or "$1$salt$digest"
+// string, so the result can be compared against it directly.
+func md5Crypt(pass, existing string) string {
+	parts := strings.SplitN(existing, "$", 4)
+	if len(parts) != 4 {
+		return ""
+	}
+	magic := "$" + parts[1] + "$"
+	salt := parts[2]
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	ctx := md5.New()
+	ctx.Write([]byte(pass))
+	ctx.Write([]byte(magic))
+	ctx.Write([]byte(salt))
+
+	ctx1 := md5.New()
+	ctx1.Write([]byte(pass))
+	ctx1.Write([]byte(salt))
+	ctx1.Write([]byte(pass))
+	final := ctx1.Sum(nil)
+
+	for i := len(pass); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		ctx.Write(final[:n])
+	}
+
+	for i := len(pass); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write([]byte(pass[:1]))
+		}
+	}
+
+	final = ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx1 := md5.New()
+		if i&1 != 0 {
+			ctx1.Write([]byte(pass))
+		} else {
+			ctx1.Write(final)
+		}
+		if i%3 != 0 {
+			ctx1.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx1.Write([]byte(pass))
+		}
+		if i&1 != 0 {
+			ctx1.Write(final)
+		} else {
+			ctx1.Write([]byte(pass))
+		}
+		final = ctx1.Sum(nil)
+	}
+
+	result := make([]byte, 0, 22)
+	for _, g := range [5][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		v := uint32(final[g[0]])<<16 | uint32(final[g[1]])<<8 | uint32(final[g[2]])
+		for i := 0; i < 4; i++ {
+			result = append(result, md5CryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	v := uint32(final[11])
+	for i := 0; i < 2; i++ {
+		result = append(result, md5CryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+
+	return magic + salt + "$" + string(result)
+}
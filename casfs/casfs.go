@@ -0,0 +1,181 @@
+// Package casfs wraps an inner httpmirror.FS with content-addressed
+// storage: blobs are stored keyed by their SHA-256 digest, with a small
+// metadata sidecar mapping each logical path to its digest, so identical
+// uploads under different logical paths (for example the same Go module
+// zip mirrored under several proxy prefixes) are stored only once.
+package casfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wzshiming/httpmirror"
+)
+
+var (
+	_ httpmirror.FS          = (*CASFS)(nil)
+	_ httpmirror.Digester    = (*CASFS)(nil)
+	_ httpmirror.RangeGetter = (*CASFS)(nil)
+)
+
+var errRangeUnsupported = errors.New("casfs: inner FS does not support range reads")
+
+// metaSuffix marks the sidecar object that maps a logical path to the
+// digest of the blob backing it.
+const metaSuffix = ".cas-meta.json"
+
+// CASFS is an httpmirror.FS that stores blobs content-addressed in Inner,
+// deduplicating identical uploads across logical paths.
+type CASFS struct {
+	Inner httpmirror.FS
+}
+
+type meta struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// digestPath returns the blob key for a SHA-256 digest, sharded by its
+// first two byte-pairs: sha256/aa/bb/aabbcc...
+func digestPath(digest string) string {
+	return fmt.Sprintf("sha256/%s/%s/%s", digest[0:2], digest[2:4], digest)
+}
+
+func metaPath(p string) string {
+	return p + metaSuffix
+}
+
+func (c *CASFS) readMeta(ctx context.Context, p string) (meta, error) {
+	f, err := c.Inner.Get(ctx, metaPath(p))
+	if err != nil {
+		return meta{}, err
+	}
+	defer f.Close()
+
+	var m meta
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return meta{}, err
+	}
+	return m, nil
+}
+
+func (c *CASFS) List(ctx context.Context, p string, fn func(fs.FileInfo) error) error {
+	return c.Inner.List(ctx, p, func(info fs.FileInfo) error {
+		if !strings.HasSuffix(info.Name(), metaSuffix) {
+			return nil
+		}
+
+		logical := strings.TrimSuffix(info.Name(), metaSuffix)
+		m, err := c.readMeta(ctx, logical)
+		if err != nil {
+			return err
+		}
+		return fn(fileInfo{name: logical, size: m.Size, modTime: info.ModTime()})
+	})
+}
+
+func (c *CASFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	m, err := c.readMeta(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.Inner.Stat(ctx, digestPath(m.Digest))
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: p, size: m.Size, modTime: info.ModTime()}, nil
+}
+
+func (c *CASFS) Get(ctx context.Context, p string) (io.ReadCloser, error) {
+	m, err := c.readMeta(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return c.Inner.Get(ctx, digestPath(m.Digest))
+}
+
+// Put streams f through a local temp file while hashing it, so the final
+// content-addressed key is known before anything is written to Inner. If
+// a blob with the same digest already exists, the upload is skipped
+// entirely and only the logical-path metadata is written.
+func (c *CASFS) Put(ctx context.Context, p string, f io.Reader) error {
+	tmp, err := os.CreateTemp("", "casfs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(f, h))
+	if err != nil {
+		return err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	if _, err := c.Inner.Stat(ctx, digestPath(digest)); err != nil {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := c.Inner.Put(ctx, digestPath(digest), tmp); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(meta{Digest: digest, Size: size})
+	if err != nil {
+		return err
+	}
+	return c.Inner.Put(ctx, metaPath(p), bytes.NewReader(data))
+}
+
+// Del removes the logical-path metadata only; the underlying blob is left
+// in place since other logical paths may still reference the same digest.
+func (c *CASFS) Del(ctx context.Context, p string) error {
+	return c.Inner.Del(ctx, metaPath(p))
+}
+
+// Digest implements httpmirror.Digester.
+func (c *CASFS) Digest(ctx context.Context, p string) (algorithm, digest string, err error) {
+	m, err := c.readMeta(ctx, p)
+	if err != nil {
+		return "", "", err
+	}
+	return "sha-256", m.Digest, nil
+}
+
+// GetRange implements httpmirror.RangeGetter if Inner does.
+func (c *CASFS) GetRange(ctx context.Context, p string, off, n int64) (io.ReadCloser, error) {
+	getter, ok := c.Inner.(httpmirror.RangeGetter)
+	if !ok {
+		return nil, errRangeUnsupported
+	}
+	m, err := c.readMeta(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return getter.GetRange(ctx, digestPath(m.Digest), off, n)
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return 0 }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
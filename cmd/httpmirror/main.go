@@ -1,13 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
-	"errors"
-	"fmt"
 
 	"github.com/wzshiming/httpmirror"
 	"github.com/wzshiming/httpmirror/minio"
@@ -22,6 +24,10 @@ var (
 	redirectLinks     string
 	hostFromFirstPath bool
 	checkSyncTimeout  time.Duration
+	auth              string
+	mitmCA            string
+	forwardProxy      bool
+	metricsAddress    string
 )
 
 func init() {
@@ -33,10 +39,41 @@ func init() {
 	flag.StringVar(&redirectLinks, "s3-redirect-links", "", "redirect links")
 	flag.BoolVar(&hostFromFirstPath, "host-from-first-path", false, "host from first path")
 	flag.DurationVar(&checkSyncTimeout, "check-sync-timeout", 0, "check sync timeout")
+	flag.StringVar(&auth, "auth", "", "basic auth source, e.g. static://user:pass or file:///etc/httpmirror.htpasswd")
+	flag.StringVar(&mitmCA, "mitm-ca", "", "path to the PEM file holding the MITM CA cert+key, generated on first run if missing")
+	flag.BoolVar(&forwardProxy, "forward-proxy", false, "serve as a standard HTTP forward proxy instead of routing by path/host")
+	flag.StringVar(&metricsAddress, "metrics-address", "", "listen on this address to serve Prometheus metrics, disabled if empty")
 
 	flag.Parse()
 }
 
+// parseAuth turns a -auth flag value into an httpmirror.Auth. The scheme
+// selects the backend: "static" takes the user/pass from the userinfo,
+// "file" takes the path to an htpasswd file.
+func parseAuth(s string) (httpmirror.Auth, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -auth %q: %w", s, err)
+	}
+
+	switch u.Scheme {
+	case "static":
+		if u.User == nil {
+			return nil, fmt.Errorf("invalid -auth %q: missing user:pass", s)
+		}
+		pass, _ := u.User.Password()
+		return &httpmirror.StaticAuth{Username: u.User.Username(), Password: pass}, nil
+	case "file":
+		return &httpmirror.FileAuth{Path: u.Path}, nil
+	default:
+		return nil, fmt.Errorf("invalid -auth %q: unknown scheme %q", s, u.Scheme)
+	}
+}
+
 func main() {
 	logger := log.New(os.Stderr, "[http mirror] ", log.LstdFlags)
 
@@ -56,6 +93,34 @@ func main() {
 		client = c
 	}
 
+	authMethod, err := parseAuth(auth)
+	if err != nil {
+		logger.Println(err)
+		os.Exit(1)
+	}
+
+	var mitm *httpmirror.MITMConfig
+	if mitmCA != "" {
+		mitm, err = httpmirror.LoadOrGenerateCA(mitmCA)
+		if err != nil {
+			logger.Println("failed to load MITM CA:", err)
+			os.Exit(1)
+		}
+	}
+
+	var observability *httpmirror.Observability
+	if metricsAddress != "" {
+		observability = httpmirror.NewObservability()
+		go func() {
+			logger.Println("metrics listen on", metricsAddress)
+			if err := http.ListenAndServe(metricsAddress, observability.Handler()); err != nil {
+				logger.Println(err)
+			}
+		}()
+	}
+
+	structuredLogger := &httpmirror.SlogLogger{Logger: slog.New(slog.NewJSONHandler(os.Stderr, nil))}
+
 	ph := &httpmirror.MirrorHandler{
 		Client: &http.Client{
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -69,17 +134,21 @@ func main() {
 				Proxy: http.ProxyFromEnvironment,
 			},
 		},
-		Logger:      logger,
+		Logger:      structuredLogger,
 		RemoteCache: client,
 		RedirectLinks: func(p string) (string, bool) {
 			return fmt.Sprintf("%s/%s", redirectLinks, p), true
 		},
 		CheckSyncTimeout:  checkSyncTimeout,
 		HostFromFirstPath: hostFromFirstPath,
+		Auth:              authMethod,
+		MITM:              mitm,
+		ForwardProxy:      forwardProxy,
+		Observability:     observability,
 	}
 
 	logger.Println("listen on", address)
-	err := http.ListenAndServe(address, ph)
+	err = http.ListenAndServe(address, ph)
 	if err != nil {
 		logger.Println(err)
 		os.Exit(1)
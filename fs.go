@@ -13,3 +13,18 @@ type FS interface {
 	Put(ctx context.Context, p string, f io.Reader) (err error)
 	Del(ctx context.Context, p string) error
 }
+
+// Digester is implemented by FS backends that can report a content
+// digest for a stored object without re-reading its bytes, so
+// MirrorHandler can surface it as Digest/ETag response headers.
+type Digester interface {
+	Digest(ctx context.Context, p string) (algorithm, digest string, err error)
+}
+
+// RangeGetter is implemented by FS backends that can read a byte range of
+// an already-stored object without transferring the rest of it, so
+// MirrorHandler can serve 206 Partial Content straight from the mirror
+// instead of redirecting the client to RedirectLinks.
+type RangeGetter interface {
+	GetRange(ctx context.Context, p string, off, n int64) (io.ReadCloser, error)
+}
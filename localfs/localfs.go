@@ -0,0 +1,139 @@
+// Package localfs implements httpmirror.FS backed by a directory on the
+// local filesystem.
+package localfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/wzshiming/httpmirror"
+)
+
+var (
+	_ httpmirror.FS          = (*LocalFS)(nil)
+	_ httpmirror.RangeGetter = (*LocalFS)(nil)
+)
+
+// LocalFS stores blobs as regular files under Root, writing them
+// atomically via a temp file + rename.
+type LocalFS struct {
+	// Root is the directory blobs are stored under.
+	Root string
+}
+
+// NewLocalFS returns a LocalFS rooted at root, creating it if it doesn't
+// already exist.
+func NewLocalFS(root string) (*LocalFS, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalFS{Root: root}, nil
+}
+
+func (l *LocalFS) path(p string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(p))
+}
+
+func (l *LocalFS) List(ctx context.Context, p string, fn func(fs.FileInfo) error) error {
+	root := l.path(p)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == root {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(l.Root, name)
+		if err != nil {
+			return err
+		}
+
+		return fn(namedFileInfo{FileInfo: info, name: filepath.ToSlash(rel)})
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *LocalFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	return os.Stat(l.path(p))
+}
+
+func (l *LocalFS) Get(ctx context.Context, p string) (io.ReadCloser, error) {
+	return os.Open(l.path(p))
+}
+
+func (l *LocalFS) Put(ctx context.Context, p string, f io.Reader) error {
+	target := l.path(p)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, target); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+func (l *LocalFS) Del(ctx context.Context, p string) error {
+	return os.Remove(l.path(p))
+}
+
+// GetRange implements httpmirror.RangeGetter.
+func (l *LocalFS) GetRange(ctx context.Context, p string, off, n int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(p))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, n), f}, nil
+}
+
+// namedFileInfo overrides Name so List reports the full key relative to
+// Root (matching flat-keyed backends like S3) instead of just the base
+// file name that fs.DirEntry.Info would give.
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (n namedFileInfo) Name() string { return n.name }
@@ -0,0 +1,52 @@
+package httpmirror
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RequestLog is a single structured record describing how MirrorHandler
+// served one request.
+type RequestLog struct {
+	Host        string
+	Path        string
+	UpstreamURL string
+	CacheResult string
+	SourceSize  int64
+	CacheSize   int64
+	Duration    time.Duration
+}
+
+// StructuredLogger is an optional upgrade to Logger: when m.Logger
+// implements it, MirrorHandler emits one RequestLog for each request
+// answered through the cache pipeline (a cache hit, or a miss that was
+// fetched and cached), in addition to the free-form strings passed to
+// Println, so operators can plug the mirror into existing structured log
+// pipelines. Requests proxied straight to the source, answered with not
+// found, or failed with an error produce no RequestLog.
+type StructuredLogger interface {
+	Logger
+	LogRequest(RequestLog)
+}
+
+// SlogLogger adapts a *slog.Logger to Logger and StructuredLogger.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func (s *SlogLogger) Println(v ...interface{}) {
+	s.Logger.Info(fmt.Sprint(v...))
+}
+
+func (s *SlogLogger) LogRequest(l RequestLog) {
+	s.Logger.Info("request",
+		"host", l.Host,
+		"path", l.Path,
+		"upstream_url", l.UpstreamURL,
+		"cache_result", l.CacheResult,
+		"source_size", l.SourceSize,
+		"cache_size", l.CacheSize,
+		"duration_ms", l.Duration.Milliseconds(),
+	)
+}
@@ -36,6 +36,22 @@ type MirrorHandler struct {
 	// HostFromFirstPath is the host from the first path
 	HostFromFirstPath bool
 
+	// Auth optionally gates access to the mirror with HTTP Basic
+	// credentials. When nil, the mirror is open to anyone.
+	Auth Auth
+	// ForwardProxy serves requests as a standard HTTP forward proxy
+	// instead of deriving the upstream from the path/host. When true,
+	// failed Auth challenges use 407 instead of 401.
+	ForwardProxy bool
+	// MITM enables CONNECT tunnel interception. When set, CONNECT
+	// requests are terminated with a certificate minted for the
+	// requested host and fed back into the caching pipeline; when nil,
+	// CONNECT falls back to a plain hijack-and-splice.
+	MITM *MITMConfig
+	// Observability optionally collects Prometheus metrics for this
+	// handler. Safe to leave nil.
+	Observability *Observability
+
 	// BlockSuffix is for block some source
 	BlockSuffix []string
 
@@ -47,6 +63,44 @@ type Logger interface {
 }
 
 func (m *MirrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.Auth != nil {
+		proxy := m.ForwardProxy || r.Method == http.MethodConnect
+		user, ok := m.Auth.Validate(r, proxy)
+		if !ok {
+			m.Auth.Challenge(w, proxy)
+			if proxy {
+				http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if m.Logger != nil {
+			m.Logger.Println("Auth", user, r.URL)
+		}
+	}
+
+	m.serveAuthenticated(w, r)
+}
+
+// serveAuthenticated runs everything ServeHTTP does once a request has
+// cleared (or doesn't need) the Auth gate. handleConnect's MITM path
+// calls this directly for requests decrypted out of an
+// already-authenticated CONNECT tunnel, so a client isn't asked to
+// present credentials a second time inside the tunnel, where a
+// Proxy-Authorization header set on the original CONNECT is no longer
+// available.
+func (m *MirrorHandler) serveAuthenticated(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		m.handleConnect(w, r)
+		return
+	}
+
+	if m.ForwardProxy {
+		m.forwardProxyResponse(w, r)
+		return
+	}
+
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -56,6 +110,7 @@ func (m *MirrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if len(m.BlockSuffix) != 0 {
 		for _, suffix := range m.BlockSuffix {
 			if strings.HasSuffix(path, suffix) {
+				m.Observability.recordRequest(r.Host, "blocked")
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
@@ -114,6 +169,7 @@ func (m *MirrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	start := time.Now()
 	file := path.Join(r.Host, r.URL.Path)
 	u, ok := m.RedirectLinks(file)
 	if !ok {
@@ -155,7 +211,14 @@ func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if m.CheckSyncTimeout == 0 {
+			if m.tryServeRange(w, r, file, cacheInfo.Size()) {
+				m.finishCacheResponse(r, "hit", 0, cacheInfo.Size(), start)
+				doneCache()
+				return
+			}
+			m.setDigestHeaders(ctx, w, file)
 			http.Redirect(w, r, u, http.StatusFound)
+			m.finishCacheResponse(r, "hit", 0, cacheInfo.Size(), start)
 			doneCache()
 			return
 		}
@@ -167,7 +230,14 @@ func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 			if m.Logger != nil {
 				m.Logger.Println("Source Miss", u, err)
 			}
+			if m.tryServeRange(w, r, file, cacheInfo.Size()) {
+				m.finishCacheResponse(r, "hit", 0, cacheInfo.Size(), start)
+				doneCache()
+				return
+			}
+			m.setDigestHeaders(ctx, w, file)
 			http.Redirect(w, r, u, http.StatusFound)
+			m.finishCacheResponse(r, "hit", 0, cacheInfo.Size(), start)
 			doneCache()
 			return
 		}
@@ -176,7 +246,14 @@ func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 		sourceSize := sourceInfo.Size()
 		cacheSize := cacheInfo.Size()
 		if cacheSize != 0 && (sourceSize <= 0 || sourceSize == cacheSize) {
+			if m.tryServeRange(w, r, file, cacheInfo.Size()) {
+				m.finishCacheResponse(r, "hit", sourceSize, cacheSize, start)
+				doneCache()
+				return
+			}
+			m.setDigestHeaders(ctx, w, file)
 			http.Redirect(w, r, u, http.StatusFound)
+			m.finishCacheResponse(r, "hit", sourceSize, cacheSize, start)
 			doneCache()
 			return
 		}
@@ -186,12 +263,38 @@ func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if r.Header.Get("Range") != "" {
+		// cacheRangeResponse writes status and body to w itself, so it
+		// must run on this goroutine: w is not safe to touch once
+		// ServeHTTP returns, which rules out the errCh/ctx.Done()
+		// pattern used below for the non-range path.
+		m.Observability.fetchStarted()
+		err := m.cacheRangeResponse(w, r, file, r.URL.String())
+		m.Observability.fetchFinished()
+		doneCache()
+		if err != nil {
+			if errors.Is(err, ErrNotOK) {
+				m.notFoundResponse(w, r)
+				return
+			}
+			m.errorResponse(w, r, err)
+			return
+		}
+		cacheSize := int64(0)
+		if info, statErr := m.RemoteCache.Stat(ctx, file); statErr == nil {
+			cacheSize = info.Size()
+		}
+		m.finishCacheResponse(r, "miss", 0, cacheSize, start)
+		return
+	}
+
 	errCh := make(chan error, 1)
 
+	m.Observability.fetchStarted()
 	go func() {
 		defer doneCache()
-		err = m.cacheFile(context.Background(), file, r.URL.String(), u)
-		errCh <- err
+		defer m.Observability.fetchFinished()
+		errCh <- m.cacheFile(context.Background(), r.Host, file, r.URL.String(), u)
 	}()
 
 	select {
@@ -207,17 +310,61 @@ func (m *MirrorHandler) cacheResponse(w http.ResponseWriter, r *http.Request) {
 			m.errorResponse(w, r, err)
 			return
 		}
+		cacheSize := int64(0)
+		if info, statErr := m.RemoteCache.Stat(ctx, file); statErr == nil {
+			cacheSize = info.Size()
+		}
+		m.setDigestHeaders(ctx, w, file)
 		http.Redirect(w, r, u, http.StatusFound)
+		m.finishCacheResponse(r, "miss", 0, cacheSize, start)
+		return
+	}
+}
+
+// finishCacheResponse records the Prometheus outcome counter and, if
+// m.Logger implements StructuredLogger, emits a structured per-request
+// log record.
+func (m *MirrorHandler) finishCacheResponse(r *http.Request, result string, sourceSize, cacheSize int64, start time.Time) {
+	m.Observability.recordRequest(r.Host, result)
+
+	sl, ok := m.Logger.(StructuredLogger)
+	if !ok {
 		return
 	}
+	sl.LogRequest(RequestLog{
+		Host:        r.Host,
+		Path:        r.URL.Path,
+		UpstreamURL: r.URL.String(),
+		CacheResult: result,
+		SourceSize:  sourceSize,
+		CacheSize:   cacheSize,
+		Duration:    time.Since(start),
+	})
 }
 
-func (m *MirrorHandler) cacheFile(ctx context.Context, key, sourceFile, cacheFile string) error {
+// setDigestHeaders surfaces the cache backend's content digest for file,
+// if it implements Digester, as Digest/ETag response headers.
+func (m *MirrorHandler) setDigestHeaders(ctx context.Context, w http.ResponseWriter, file string) {
+	d, ok := m.RemoteCache.(Digester)
+	if !ok {
+		return
+	}
+	algorithm, digest, err := d.Digest(ctx, file)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Digest", algorithm+"="+digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+}
+
+func (m *MirrorHandler) cacheFile(ctx context.Context, host, key, sourceFile, cacheFile string) error {
+	fetchStart := time.Now()
 	resp, info, err := httpGet(ctx, m.client(), sourceFile)
 	if err != nil {
 		return err
 	}
 	defer resp.Close()
+	m.Observability.observeFetch(time.Since(fetchStart))
 
 	var body io.Reader = resp
 
@@ -240,6 +387,7 @@ func (m *MirrorHandler) cacheFile(ctx context.Context, key, sourceFile, cacheFil
 		}
 		return err
 	}
+	m.Observability.recordBytesCached(host, contentLength)
 	if m.Logger != nil {
 		m.Logger.Println("Cached", cacheFile, contentLength)
 	}
@@ -255,6 +403,8 @@ func (m *MirrorHandler) directResponse(w http.ResponseWriter, r *http.Request) {
 	}
 	defer resp.Body.Close()
 
+	removeHopByHopHeaders(resp.Header)
+
 	header := w.Header()
 	for k, v := range resp.Header {
 		if _, ok := ignoreHeader[k]; ok {
@@ -284,6 +434,8 @@ func (m *MirrorHandler) directResponse(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	m.Observability.recordRequest(r.Host, "miss")
 }
 
 func (m *MirrorHandler) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
@@ -291,10 +443,12 @@ func (m *MirrorHandler) errorResponse(w http.ResponseWriter, r *http.Request, er
 	if m.Logger != nil {
 		m.Logger.Println(e)
 	}
+	m.Observability.recordRequest(r.Host, "error")
 	http.Error(w, e, http.StatusInternalServerError)
 }
 
 func (m *MirrorHandler) notFoundResponse(w http.ResponseWriter, r *http.Request) {
+	m.Observability.recordRequest(r.Host, "miss")
 	if m.NotFound != nil {
 		m.NotFound.ServeHTTP(w, r)
 	} else {
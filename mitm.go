@@ -0,0 +1,282 @@
+package httpmirror
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	errIncompleteCA = errors.New("httpmirror: CA file missing certificate or private key")
+	errNotRSAKey    = errors.New("httpmirror: CA private key is not an RSA key")
+)
+
+// MITMConfig holds the CA used to mint per-host leaf certificates for
+// CONNECT tunnels, so HTTPS requests can be decrypted and run through the
+// normal caching pipeline.
+type MITMConfig struct {
+	CACert *x509.Certificate
+	CAKey  *rsa.PrivateKey
+
+	certMut sync.Mutex
+	certs   map[string]*tls.Certificate
+}
+
+// LoadOrGenerateCA loads a CA certificate/key pair from a single PEM file
+// at path, generating a new self-signed CA and persisting it to path if
+// the file doesn't exist or doesn't parse.
+func LoadOrGenerateCA(path string) (*MITMConfig, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if mitm, err := parseCA(data); err == nil {
+			return mitm, nil
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "httpmirror MITM CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(&buf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &MITMConfig{CACert: leaf, CAKey: key}, nil
+}
+
+// parseCA reads the CA certificate and key out of a PEM blob holding both.
+func parseCA(data []byte) (*MITMConfig, error) {
+	var certDER []byte
+	var key *rsa.PrivateKey
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			certDER = block.Bytes
+		case "RSA PRIVATE KEY":
+			k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := k.(*rsa.PrivateKey)
+			if !ok {
+				return nil, errNotRSAKey
+			}
+			key = rsaKey
+		}
+	}
+
+	if certDER == nil || key == nil {
+		return nil, errIncompleteCA
+	}
+
+	leaf, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	return &MITMConfig{CACert: leaf, CAKey: key}, nil
+}
+
+// leafFor returns a TLS certificate for host, generating and caching a
+// new leaf signed by the CA the first time host is seen.
+func (c *MITMConfig) leafFor(host string) (*tls.Certificate, error) {
+	c.certMut.Lock()
+	defer c.certMut.Unlock()
+
+	if c.certs == nil {
+		c.certs = map[string]*tls.Certificate{}
+	}
+	if cert, ok := c.certs[host]; ok {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{host},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.CACert, &key.PublicKey, c.CAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, c.CACert.Raw},
+		PrivateKey:  key,
+	}
+	c.certs[host] = cert
+	return cert, nil
+}
+
+// handleConnect implements the CONNECT method. When MITM is configured it
+// terminates TLS with a certificate minted for the requested host and
+// feeds the decrypted requests back into serveAuthenticated, since the
+// tunnel itself was already authenticated by the outer CONNECT;
+// otherwise it falls back to a plain hijack-and-splice, mirroring the
+// goproxy HijackConnect pattern.
+func (m *MirrorHandler) handleConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if m.MITM == nil {
+		m.connectSplice(w, r, hijacker)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		m.errorResponse(w, r, err)
+		return
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return m.MITM.leafFor(name)
+		},
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests read off the tunnel are origin-form; give them the
+		// absolute https URL that forwardProxyResponse expects.
+		if r.URL.Host == "" {
+			r.URL.Scheme = "https"
+			r.URL.Host = r.Host
+		}
+		m.serveAuthenticated(w, r)
+	})
+	(&http.Server{Handler: handler}).Serve(newSingleConnListener(tlsConn))
+}
+
+// connectSplice hijacks the client connection, dials the requested host
+// directly and splices the two connections together.
+func (m *MirrorHandler) connectSplice(w http.ResponseWriter, r *http.Request, hijacker http.Hijacker) {
+	target, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		m.errorResponse(w, r, err)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		target.Close()
+		m.errorResponse(w, r, err)
+		return
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		target.Close()
+		return
+	}
+
+	go func() {
+		defer target.Close()
+		defer conn.Close()
+		io.Copy(target, conn)
+	}()
+	io.Copy(conn, target)
+	conn.Close()
+	target.Close()
+}
+
+// singleConnListener is a net.Listener that yields exactly one
+// already-accepted connection, so an *http.Server can be pointed at a
+// connection obtained via Hijack.
+type singleConnListener struct {
+	conn net.Conn
+	ch   chan net.Conn
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	ch := make(chan net.Conn, 1)
+	ch <- conn
+	close(ch)
+	return &singleConnListener{conn: conn, ch: ch}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	c, ok := <-l.ch
+	if !ok {
+		return nil, io.EOF
+	}
+	return c, nil
+}
+
+func (l *singleConnListener) Close() error { return nil }
+
+func (l *singleConnListener) Addr() net.Addr { return l.conn.LocalAddr() }
@@ -0,0 +1,94 @@
+package httpmirror
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Observability collects Prometheus metrics for a MirrorHandler. Its
+// recording methods are safe to call on a nil *Observability, so
+// MirrorHandler doesn't need to guard every call site the way it does for
+// Logger; Handler is not, and needs one built by NewObservability. Wire
+// it up by assigning it to MirrorHandler.Observability and mounting
+// Handler() on a separate address from the mirror itself.
+type Observability struct {
+	registry *prometheus.Registry
+
+	requestsTotal   *prometheus.CounterVec
+	bytesCached     *prometheus.CounterVec
+	fetchLatency    prometheus.Histogram
+	inFlightFetches prometheus.Gauge
+}
+
+// NewObservability creates an Observability with its own Prometheus
+// registry, so it doesn't collide with metrics any other exporter in the
+// same process may register on the default one.
+func NewObservability() *Observability {
+	o := &Observability{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "httpmirror_requests_total",
+			Help: "Total requests served, by host and result (hit, miss, error or blocked).",
+		}, []string{"host", "result"}),
+		bytesCached: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "httpmirror_bytes_cached_total",
+			Help: "Total bytes written to the cache, by host.",
+		}, []string{"host"}),
+		fetchLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "httpmirror_source_fetch_duration_seconds",
+			Help:    "Latency of fetches from the upstream source.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		inFlightFetches: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "httpmirror_in_flight_fetches",
+			Help: "Source fetches currently being coalesced for concurrent requests.",
+		}),
+	}
+
+	o.registry.MustRegister(o.requestsTotal, o.bytesCached, o.fetchLatency, o.inFlightFetches)
+	return o
+}
+
+// Handler returns an http.Handler serving this Observability's metrics in
+// the Prometheus exposition format.
+func (o *Observability) Handler() http.Handler {
+	return promhttp.HandlerFor(o.registry, promhttp.HandlerOpts{})
+}
+
+func (o *Observability) recordRequest(host, result string) {
+	if o == nil {
+		return
+	}
+	o.requestsTotal.WithLabelValues(host, result).Inc()
+}
+
+func (o *Observability) recordBytesCached(host string, n int64) {
+	if o == nil || n <= 0 {
+		return
+	}
+	o.bytesCached.WithLabelValues(host).Add(float64(n))
+}
+
+func (o *Observability) observeFetch(d time.Duration) {
+	if o == nil {
+		return
+	}
+	o.fetchLatency.Observe(d.Seconds())
+}
+
+func (o *Observability) fetchStarted() {
+	if o == nil {
+		return
+	}
+	o.inFlightFetches.Inc()
+}
+
+func (o *Observability) fetchFinished() {
+	if o == nil {
+		return
+	}
+	o.inFlightFetches.Dec()
+}
@@ -0,0 +1,59 @@
+package httpmirror
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are connection-scoped headers that must not be
+// forwarded between a proxy and either of its peers, per RFC 7230 §6.1.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailers",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders strips the standard hop-by-hop headers, plus any
+// extra ones named in the Connection header, from h in place.
+func removeHopByHopHeaders(h http.Header) {
+	if connection := h.Get("Connection"); connection != "" {
+		for _, f := range strings.Split(connection, ",") {
+			h.Del(strings.TrimSpace(f))
+		}
+	}
+	for _, k := range hopByHopHeaders {
+		h.Del(k)
+	}
+}
+
+// forwardProxyResponse serves r as an ordinary HTTP forward proxy:
+// absolute-form request URIs are honored as-is instead of deriving the
+// upstream from BaseDomain/HostFromFirstPath, hop-by-hop headers are
+// stripped in both directions, and GET/HEAD still go through the normal
+// caching pipeline.
+func (m *MirrorHandler) forwardProxyResponse(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.IsAbs() {
+		m.notFoundResponse(w, r)
+		return
+	}
+
+	removeHopByHopHeaders(r.Header)
+	r.RequestURI = ""
+
+	if m.Logger != nil {
+		m.Logger.Println("Request", r.URL)
+	}
+
+	if m.RemoteCache == nil || m.RedirectLinks == nil ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		m.directResponse(w, r)
+		return
+	}
+
+	m.cacheResponse(w, r)
+}
@@ -0,0 +1,218 @@
+package httpmirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRange parses a single-range "Range: bytes=start-end" header
+// against a known resource size. Multi-range requests and anything that
+// doesn't parse cleanly report ok=false so the caller can fall back to a
+// full response.
+func parseRange(header string, size int64) (start, length int64, ok bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, false
+	}
+	spec := header[len(prefix):]
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if parts[1] != "" {
+		e, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || e < start {
+			return 0, 0, false
+		}
+		if e < end {
+			end = e
+		}
+	}
+
+	return start, end - start + 1, true
+}
+
+// tryServeRange serves a byte range of an already-cached object straight
+// from the mirror, without redirecting, when r carries a Range header
+// and RemoteCache implements RangeGetter. It reports whether it served
+// the request.
+func (m *MirrorHandler) tryServeRange(w http.ResponseWriter, r *http.Request, file string, size int64) bool {
+	getter, ok := m.RemoteCache.(RangeGetter)
+	if !ok {
+		return false
+	}
+
+	start, length, ok := parseRange(r.Header.Get("Range"), size)
+	if !ok {
+		return false
+	}
+
+	rc, err := getter.GetRange(r.Context(), file, start, length)
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+
+	m.setDigestHeaders(r.Context(), w, file)
+	header := w.Header()
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	header.Set("Accept-Ranges", "bytes")
+	w.WriteHeader(http.StatusPartialContent)
+
+	if r.Method != http.MethodHead {
+		io.Copy(w, rc)
+	}
+	return true
+}
+
+// cacheRangeResponse handles a ranged GET for an object that isn't cached
+// yet: the upstream body is downloaded once, teed into RemoteCache.Put in
+// the background through an io.Pipe, while the requested byte range is
+// streamed to the client as it arrives through a small ring buffer, so
+// the client doesn't have to wait for the whole object to download
+// first. It writes the status line and body to w itself and must
+// therefore be called synchronously from the request goroutine: once it
+// returns, the error result only ever reflects a failure that happened
+// before anything was written to w, so callers may still turn it into an
+// http.Error.
+func (m *MirrorHandler) cacheRangeResponse(w http.ResponseWriter, r *http.Request, file, sourceFile string) error {
+	fetchStart := time.Now()
+	resp, info, err := httpGet(r.Context(), m.client(), sourceFile)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	m.Observability.observeFetch(time.Since(fetchStart))
+
+	size := info.Size()
+	if size <= 0 {
+		return ErrNotOK
+	}
+
+	start, length, ok := parseRange(r.Header.Get("Range"), size)
+	if !ok {
+		start, length = 0, size
+	}
+
+	pr, pw := io.Pipe()
+	rb := newRingBuffer(64)
+
+	host := r.Host
+	go func() {
+		err := m.RemoteCache.Put(context.Background(), file, pr)
+		if err == nil {
+			m.Observability.recordBytesCached(host, size)
+		}
+		pr.CloseWithError(err)
+	}()
+
+	go func() {
+		_, err := io.Copy(io.MultiWriter(pw, rb), resp)
+		pw.CloseWithError(err)
+		rb.CloseWithError(err)
+	}()
+
+	if _, err := io.CopyN(io.Discard, rb, start); err != nil && err != io.EOF {
+		io.Copy(io.Discard, rb)
+		return err
+	}
+
+	// Past this point the response is committed: the status line (and,
+	// for GET, the first body byte) goes out on this goroutine and
+	// nothing else may touch w afterwards, so a later error can only be
+	// logged, never turned into an http.Error - the caller must not
+	// call errorResponse once we've returned.
+	if length != size {
+		header := w.Header()
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+		header.Set("Accept-Ranges", "bytes")
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	var dst io.Writer = w
+	if r.Method == http.MethodHead {
+		dst = io.Discard
+	}
+
+	if _, err := io.CopyN(dst, rb, length); err != nil && err != io.EOF {
+		if m.Logger != nil {
+			m.Logger.Println("Range Error", file, err)
+		}
+	}
+
+	// Drain anything past the requested range so the Put goroutine
+	// still sees the full object.
+	io.Copy(io.Discard, rb)
+	return nil
+}
+
+// ringBuffer is a small bounded queue of byte chunks. Writes block once
+// it is full, so a slow reader applies backpressure to the writer
+// without requiring the whole object to be buffered in memory.
+type ringBuffer struct {
+	ch       chan []byte
+	err      error
+	leftover []byte
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{ch: make(chan []byte, capacity)}
+}
+
+func (rb *ringBuffer) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	rb.ch <- b
+	return len(p), nil
+}
+
+func (rb *ringBuffer) CloseWithError(err error) error {
+	rb.err = err
+	close(rb.ch)
+	return nil
+}
+
+func (rb *ringBuffer) Read(p []byte) (int, error) {
+	for len(rb.leftover) == 0 {
+		chunk, ok := <-rb.ch
+		if !ok {
+			if rb.err != nil && rb.err != io.EOF {
+				return 0, rb.err
+			}
+			return 0, io.EOF
+		}
+		rb.leftover = chunk
+	}
+	n := copy(p, rb.leftover)
+	rb.leftover = rb.leftover[n:]
+	return n, nil
+}